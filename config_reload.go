@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// watchConfigReload installs a Viper watch on the resolved config file so
+// the daemon can pick up edits at runtime instead of requiring a restart.
+func (m *Monitor) watchConfigReload() {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		m.reloadConfig()
+	})
+	viper.WatchConfig()
+}
+
+// reloadConfig rebuilds Config from the current Viper state and applies
+// the diff surgically: only the subsystems whose inputs actually changed
+// are torn down and rebuilt. Invalid updates (bad cron spec, unparseable
+// duration, duplicate repo name) are rejected and the previous config
+// keeps running.
+func (m *Monitor) reloadConfig() {
+	old := currentCfg()
+
+	next, err := buildConfig()
+	if err != nil {
+		m.logger.Warn("config", "rejected invalid config reload: %v", err)
+		return
+	}
+
+	diff := diffConfig(old, next)
+	if len(diff) == 0 {
+		return
+	}
+	m.logger.Info("config", "reloaded: %s", strings.Join(diff, ", "))
+
+	replaceCfg(next)
+
+	m.reconcileRepos(old.Repos, next.Repos)
+
+	if old.MaxConcurrentSyncs != next.MaxConcurrentSyncs {
+		m.syncSem.setLimit(next.MaxConcurrentSyncs)
+	}
+}
+
+// reconcileRepos brings the running Monitor's repos map, watchers and
+// cron entries in line with a newly reloaded repo list: repos dropped
+// from config are torn down, repos added get a watcher and cron entry,
+// and repos that changed get their config swapped in with the watcher
+// and/or cron entry rebuilt only if the fields that drive them changed.
+func (m *Monitor) reconcileRepos(oldRepos, nextRepos []RepoConfig) {
+	oldByName := indexRepos(oldRepos)
+	nextByName := indexRepos(nextRepos)
+
+	for name := range oldByName {
+		if _, ok := nextByName[name]; !ok {
+			m.removeRepo(name)
+		}
+	}
+	for name, next := range nextByName {
+		old, existed := oldByName[name]
+		if !existed {
+			m.addRepo(next)
+			continue
+		}
+		m.updateRepo(name, old, next)
+	}
+}
+
+func (m *Monitor) addRepo(rc RepoConfig) {
+	repo := newRepo(rc)
+
+	m.reposMu.Lock()
+	m.repos[rc.Name] = repo
+	m.reposMu.Unlock()
+
+	if err := m.initRepoWatcher(repo); err != nil {
+		m.logger.Error("config", "[%s] failed to start watcher for new repo: %v", rc.Name, err)
+	} else {
+		go m.runRepoWatchLoop(rc.Name, repo)
+	}
+
+	m.scheduleRepoCron(rc.Name, repo)
+	m.logger.Info("config", "repo %s added", rc.Name)
+}
+
+func (m *Monitor) removeRepo(name string) {
+	m.reposMu.Lock()
+	repo, ok := m.repos[name]
+	delete(m.repos, name)
+	m.reposMu.Unlock()
+	if !ok {
+		return
+	}
+
+	m.removeCronEntry(name)
+	close(repo.done)
+	if w := repo.getWatcher(); w != nil {
+		w.Close()
+	}
+	m.logger.Info("config", "repo %s removed", name)
+}
+
+func (m *Monitor) updateRepo(name string, old, next RepoConfig) {
+	repo, ok := m.repo(name)
+	if !ok {
+		return
+	}
+	repo.setConfig(next)
+
+	if old.WatchDir != next.WatchDir || !equalPatterns(old.IgnorePatterns, next.IgnorePatterns) {
+		// initRepoWatcher installs the new watcher and closes whatever it
+		// replaced itself, under repo.watcherMu, so the swap can't race the
+		// watch-loop goroutine reading repo.watcher.
+		if err := m.initRepoWatcher(repo); err != nil {
+			m.logger.Error("config", "[%s] failed to rebuild watcher after reload: %v", name, err)
+		}
+	}
+
+	if old.SyncInterval != next.SyncInterval {
+		m.removeCronEntry(name)
+		m.scheduleRepoCron(name, repo)
+	}
+}
+
+// diffConfig returns a human-readable list of "field: old -> new" entries
+// for every per-repo field that changed between old and next, and for the
+// global fields verbose, sync_backend and max_concurrent_syncs. Other
+// global fields (log settings, pid_file, state_db_path, control_socket,
+// notifiers) are not compared, so a reload that changes only those yields
+// an empty list and reloadConfig keeps the previous Config.
+func diffConfig(old, next *Config) []string {
+	var changes []string
+	add := func(field string, oldVal, newVal interface{}) {
+		changes = append(changes, fmt.Sprintf("%s: %v -> %v", field, oldVal, newVal))
+	}
+
+	if old.Verbose != next.Verbose {
+		add("verbose", old.Verbose, next.Verbose)
+	}
+	if old.SyncBackend != next.SyncBackend {
+		add("sync_backend", old.SyncBackend, next.SyncBackend)
+	}
+	if old.MaxConcurrentSyncs != next.MaxConcurrentSyncs {
+		add("max_concurrent_syncs", old.MaxConcurrentSyncs, next.MaxConcurrentSyncs)
+	}
+
+	changes = append(changes, diffRepos(old.Repos, next.Repos)...)
+	return changes
+}
+
+func diffRepos(old, next []RepoConfig) []string {
+	oldByName := indexRepos(old)
+	nextByName := indexRepos(next)
+
+	var changes []string
+	for name := range oldByName {
+		if _, ok := nextByName[name]; !ok {
+			changes = append(changes, fmt.Sprintf("repo %s: removed", name))
+		}
+	}
+	for name, n := range nextByName {
+		o, existed := oldByName[name]
+		if !existed {
+			changes = append(changes, fmt.Sprintf("repo %s: added", name))
+			continue
+		}
+		changes = append(changes, diffRepo(name, o, n)...)
+	}
+	return changes
+}
+
+func diffRepo(name string, old, next RepoConfig) []string {
+	var changes []string
+	add := func(field string, oldVal, newVal interface{}) {
+		changes = append(changes, fmt.Sprintf("repo %s %s: %v -> %v", name, field, oldVal, newVal))
+	}
+
+	if old.WatchDir != next.WatchDir {
+		add("watch_dir", old.WatchDir, next.WatchDir)
+	}
+	if old.RemoteDir != next.RemoteDir {
+		add("remote_dir", old.RemoteDir, next.RemoteDir)
+	}
+	if old.NextcloudURL != next.NextcloudURL {
+		add("url", old.NextcloudURL, next.NextcloudURL)
+	}
+	if old.Username != next.Username {
+		add("user", old.Username, next.Username)
+	}
+	if old.Password != next.Password {
+		changes = append(changes, fmt.Sprintf("repo %s password: (changed)", name))
+	}
+	if old.SyncCooldown != next.SyncCooldown {
+		add("sync_cooldown", old.SyncCooldown, next.SyncCooldown)
+	}
+	if old.SyncInterval != next.SyncInterval {
+		add("sync_interval", old.SyncInterval, next.SyncInterval)
+	}
+	if !equalPatterns(old.IgnorePatterns, next.IgnorePatterns) {
+		add("ignore_patterns", old.IgnorePatterns, next.IgnorePatterns)
+	}
+
+	return changes
+}
+
+func indexRepos(repos []RepoConfig) map[string]RepoConfig {
+	out := make(map[string]RepoConfig, len(repos))
+	for _, r := range repos {
+		out[r.Name] = r
+	}
+	return out
+}
+
+func equalPatterns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
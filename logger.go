@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Level is a logging verbosity level, ordered low to high.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// parseLevel maps a config string to a Level, defaulting to LevelInfo for
+// anything unrecognized.
+func parseLevel(s string) Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// ringBuffer keeps the last `size` log lines in memory, oldest dropped
+// first, for the control socket's `log` command.
+type ringBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	size  int
+	next  int
+	full  bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	if size <= 0 {
+		size = 500
+	}
+	return &ringBuffer{lines: make([]string, size), size: size}
+}
+
+func (r *ringBuffer) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % r.size
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// dump returns a snapshot of the buffer, oldest line first.
+func (r *ringBuffer) dump() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		out := make([]string, r.next)
+		copy(out, r.lines[:r.next])
+		return out
+	}
+	out := make([]string, r.size)
+	copy(out, r.lines[r.next:])
+	copy(out[r.size-r.next:], r.lines[:r.next])
+	return out
+}
+
+// Logger is a leveled, component-tagged logger that mirrors every line
+// it writes into an in-memory ring buffer so the control socket's `log`
+// command can dump recent history without re-reading the log file.
+type Logger struct {
+	out   *log.Logger
+	level Level
+	ring  *ringBuffer
+}
+
+// NewLogger builds a Logger writing to w, dropping messages below level,
+// and keeping ringSize lines in its ring buffer.
+func NewLogger(w io.Writer, level Level, ringSize int) *Logger {
+	return &Logger{
+		out:   log.New(w, "", log.LstdFlags),
+		level: level,
+		ring:  newRingBuffer(ringSize),
+	}
+}
+
+func (l *Logger) logf(level Level, component, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+	msg := fmt.Sprintf("[%s] [%s] %s", level, component, fmt.Sprintf(format, args...))
+	l.out.Println(msg)
+	l.ring.add(msg)
+}
+
+// Debug logs a component-tagged message at debug level.
+func (l *Logger) Debug(component, format string, args ...interface{}) {
+	l.logf(LevelDebug, component, format, args...)
+}
+
+// Info logs a component-tagged message at info level.
+func (l *Logger) Info(component, format string, args ...interface{}) {
+	l.logf(LevelInfo, component, format, args...)
+}
+
+// Warn logs a component-tagged message at warn level.
+func (l *Logger) Warn(component, format string, args ...interface{}) {
+	l.logf(LevelWarn, component, format, args...)
+}
+
+// Error logs a component-tagged message at error level.
+func (l *Logger) Error(component, format string, args ...interface{}) {
+	l.logf(LevelError, component, format, args...)
+}
+
+// Fatal logs at error level and terminates the process, for call sites
+// that need the old log.Logger.Fatal behavior.
+func (l *Logger) Fatal(component, format string, args ...interface{}) {
+	l.logf(LevelError, component, format, args...)
+	os.Exit(1)
+}
+
+// Lines returns a snapshot of the ring buffer, oldest line first.
+func (l *Logger) Lines() []string {
+	return l.ring.dump()
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"strings"
+	"sort"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,29 +20,76 @@ import (
 	"github.com/spf13/viper"
 )
 
-// Config holds all configuration values
+// Config holds all configuration values that apply to the daemon as a
+// whole. Per-repo values (watch_dir, remote_dir, url, credentials, sync
+// timing, ignore patterns) live in RepoConfig instead.
 type Config struct {
+	Repos              []RepoConfig
+	MaxConcurrentSyncs int
+	LogFile            string
+	PidFile            string
+	Verbose            bool
+	SyncBackend        string
+	StateDBPath        string
+	LogLevel           string
+	LogRingSize        int
+	ControlSocket      string
+	Notifiers          []NotifierConfig
+}
+
+// RepoConfig is one entry of the `repos:` yaml list: everything needed to
+// watch and sync a single local directory against a single remote.
+type RepoConfig struct {
+	Name           string
 	WatchDir       string
 	RemoteDir      string
 	NextcloudURL   string
 	Username       string
 	Password       string
-	LogFile        string
-	PidFile        string
-	SyncCooldown   time.Duration
 	SyncInterval   string
+	SyncCooldown   time.Duration
 	IgnorePatterns []string
-	Verbose        bool
+}
+
+// rawRepoConfig mirrors one `repos:` yaml entry before its sync_interval
+// and sync_cooldown have been validated and parsed.
+type rawRepoConfig struct {
+	Name           string   `mapstructure:"name"`
+	WatchDir       string   `mapstructure:"watch_dir"`
+	RemoteDir      string   `mapstructure:"remote_dir"`
+	URL            string   `mapstructure:"url"`
+	Username       string   `mapstructure:"user"`
+	Password       string   `mapstructure:"password"`
+	SyncInterval   string   `mapstructure:"sync_interval"`
+	SyncCooldown   string   `mapstructure:"sync_cooldown"`
+	IgnorePatterns []string `mapstructure:"ignore_patterns"`
 }
 
 var (
-	cfg *Config
+	cfg   *Config
+	cfgMu sync.RWMutex
 )
 
 func init() {
 	cfg = initConfig()
 }
 
+// currentCfg returns the active Config. Reads go through this accessor
+// (rather than the cfg var directly) so that a config reload can swap
+// the whole struct out from under running goroutines atomically.
+func currentCfg() *Config {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return cfg
+}
+
+// replaceCfg atomically swaps in a newly loaded Config.
+func replaceCfg(next *Config) {
+	cfgMu.Lock()
+	cfg = next
+	cfgMu.Unlock()
+}
+
 func initConfig() *Config {
 	// Set up Viper
 	viper.SetConfigName("nextcloud_monitor")
@@ -52,7 +102,10 @@ func initConfig() *Config {
 	viper.SetEnvPrefix("NEXTCLOUD")
 	viper.AutomaticEnv()
 
-	// Set defaults
+	// Set defaults. watch_dir/remote_dir/... are the legacy single-repo
+	// keys: buildRepos wraps them into a default repo entry when `repos`
+	// isn't set, and they also supply the per-field fallback for any
+	// repos entry that omits sync_interval/sync_cooldown/ignore_patterns.
 	viper.SetDefault("watch_dir", "~/org/roam")
 	viper.SetDefault("remote_dir", "/org/roam")
 	viper.SetDefault("url", "https://nextcloud.example.com")
@@ -63,6 +116,12 @@ func initConfig() *Config {
 	viper.SetDefault("sync_cooldown", "10s")
 	viper.SetDefault("sync_interval", "*/5 * * * *")
 	viper.SetDefault("verbose", false)
+	viper.SetDefault("sync_backend", "external")
+	viper.SetDefault("state_db_path", "~/.cache/nextcloud_monitor/state.db")
+	viper.SetDefault("log_level", "info")
+	viper.SetDefault("log_ring_size", 500)
+	viper.SetDefault("control_socket", "/run/nc_monitor/nc_monitor.sock")
+	viper.SetDefault("max_concurrent_syncs", 4)
 	viper.SetDefault("ignore_patterns", []string{
 		"*.tmp", "*.temp", "*.log", "*~", ".DS_Store",
 		"Thumbs.db", ".git/*", "*.swp", "*.lock", ".nextcloud_sync_*",
@@ -75,67 +134,330 @@ func initConfig() *Config {
 		}
 	}
 
-	// Parse sync cooldown duration
-	cooldownStr := viper.GetString("sync_cooldown")
-	cooldown, err := time.ParseDuration(cooldownStr)
+	next, err := buildConfig()
 	if err != nil {
-		log.Printf("Invalid sync_cooldown format '%s', using default 10s", cooldownStr)
-		cooldown = 10 * time.Second
+		log.Printf("%v, falling back to default sync_cooldown", err)
+		viper.Set("sync_cooldown", "10s")
+		next, err = buildConfig()
+		if err != nil {
+			log.Fatalf("failed to build config even with default sync_cooldown: %v", err)
+		}
+	}
+	return next
+}
+
+// buildConfig reads the current Viper state into a Config, validating
+// the fields that can make the daemon misbehave if they're malformed.
+// Call sites that want best-effort startup behavior on error should fall
+// back to a default; reloadConfig rejects the update outright instead.
+func buildConfig() (*Config, error) {
+	maxConcurrent := viper.GetInt("max_concurrent_syncs")
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	var notifiers []NotifierConfig
+	if err := viper.UnmarshalKey("notifiers", &notifiers); err != nil {
+		return nil, fmt.Errorf("invalid notifiers config: %v", err)
+	}
+
+	repos, err := buildRepos()
+	if err != nil {
+		return nil, err
 	}
 
 	return &Config{
-		WatchDir:       viper.GetString("watch_dir"),
-		RemoteDir:      viper.GetString("remote_dir"),
-		NextcloudURL:   viper.GetString("url"),
-		Username:       viper.GetString("user"),
-		Password:       viper.GetString("password"),
-		LogFile:        viper.GetString("log_file"),
-		PidFile:        viper.GetString("pid_file"),
-		SyncCooldown:   cooldown,
-		SyncInterval:   viper.GetString("sync_interval"),
-		Verbose:        viper.GetBool("verbose"),
-		IgnorePatterns: viper.GetStringSlice("ignore_patterns"),
+		Repos:              repos,
+		MaxConcurrentSyncs: maxConcurrent,
+		LogFile:            viper.GetString("log_file"),
+		PidFile:            viper.GetString("pid_file"),
+		Verbose:            viper.GetBool("verbose"),
+		SyncBackend:        viper.GetString("sync_backend"),
+		StateDBPath:        viper.GetString("state_db_path"),
+		LogLevel:           viper.GetString("log_level"),
+		LogRingSize:        viper.GetInt("log_ring_size"),
+		ControlSocket:      viper.GetString("control_socket"),
+		Notifiers:          notifiers,
+	}, nil
+}
+
+// buildRepos reads the `repos:` list if present. Otherwise it wraps the
+// legacy top-level watch_dir/remote_dir/url/... fields into a single
+// repo named "default", preserving single-repo backward compatibility.
+func buildRepos() ([]RepoConfig, error) {
+	if !viper.IsSet("repos") {
+		repo, err := buildRepoConfig(rawRepoConfig{Name: "default"})
+		if err != nil {
+			return nil, err
+		}
+		return []RepoConfig{repo}, nil
+	}
+
+	var raw []rawRepoConfig
+	if err := viper.UnmarshalKey("repos", &raw); err != nil {
+		return nil, fmt.Errorf("invalid repos config: %v", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("repos list must not be empty")
+	}
+
+	repos := make([]RepoConfig, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for _, r := range raw {
+		if r.Name == "" {
+			return nil, fmt.Errorf("every repos entry needs a name")
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("duplicate repo name %q", r.Name)
+		}
+		seen[r.Name] = true
+
+		repo, err := buildRepoConfig(r)
+		if err != nil {
+			return nil, fmt.Errorf("repo %q: %v", r.Name, err)
+		}
+		repos = append(repos, repo)
 	}
+	return repos, nil
+}
+
+// buildRepoConfig fills in any field r omits from the top-level
+// watch_dir/remote_dir/... defaults, then validates sync_interval and
+// sync_cooldown.
+func buildRepoConfig(r rawRepoConfig) (RepoConfig, error) {
+	watchDir := r.WatchDir
+	if watchDir == "" {
+		watchDir = viper.GetString("watch_dir")
+	}
+	remoteDir := r.RemoteDir
+	if remoteDir == "" {
+		remoteDir = viper.GetString("remote_dir")
+	}
+	url := r.URL
+	if url == "" {
+		url = viper.GetString("url")
+	}
+	username := r.Username
+	if username == "" {
+		username = viper.GetString("user")
+	}
+	password := r.Password
+	if password == "" {
+		password = viper.GetString("password")
+	}
+
+	interval := r.SyncInterval
+	if interval == "" {
+		interval = viper.GetString("sync_interval")
+	}
+	if _, err := cron.ParseStandard(interval); err != nil {
+		return RepoConfig{}, fmt.Errorf("invalid sync_interval %q: %v", interval, err)
+	}
+
+	cooldownStr := r.SyncCooldown
+	if cooldownStr == "" {
+		cooldownStr = viper.GetString("sync_cooldown")
+	}
+	cooldown, err := time.ParseDuration(cooldownStr)
+	if err != nil {
+		return RepoConfig{}, fmt.Errorf("invalid sync_cooldown %q: %v", cooldownStr, err)
+	}
+
+	patterns := r.IgnorePatterns
+	if patterns == nil {
+		patterns = viper.GetStringSlice("ignore_patterns")
+	}
+
+	return RepoConfig{
+		Name:           r.Name,
+		WatchDir:       watchDir,
+		RemoteDir:      remoteDir,
+		NextcloudURL:   url,
+		Username:       username,
+		Password:       password,
+		SyncInterval:   interval,
+		SyncCooldown:   cooldown,
+		IgnorePatterns: patterns,
+	}, nil
+}
+
+// Repo is one watched directory/remote pair. Monitor owns one per entry
+// in cfg.Repos, each with its own fsnotify watcher, pending-event set and
+// last-sync time so repos behave independently of one another.
+type Repo struct {
+	name string
+
+	cfgMu sync.RWMutex
+	cfg   RepoConfig
+
+	watcherMu sync.RWMutex
+	watcher   *fsnotify.Watcher
+	lastSync  time.Time
+
+	// done is closed exactly once, when the repo is torn down by
+	// removeRepo, so its watch loop goroutine stops instead of spinning
+	// once the watcher it was reading from is gone.
+	done chan struct{}
+
+	pendingMu sync.Mutex
+	pending   map[string]struct{}
+}
+
+func newRepo(rc RepoConfig) *Repo {
+	return &Repo{name: rc.Name, cfg: rc, pending: make(map[string]struct{}), done: make(chan struct{})}
+}
+
+func (r *Repo) config() RepoConfig {
+	r.cfgMu.RLock()
+	defer r.cfgMu.RUnlock()
+	return r.cfg
+}
+
+func (r *Repo) setConfig(rc RepoConfig) {
+	r.cfgMu.Lock()
+	r.cfg = rc
+	r.cfgMu.Unlock()
+}
+
+// getWatcher returns the repo's current watcher, or nil if it hasn't been
+// initialized yet. Teardown closes the watcher but leaves it in place.
+func (r *Repo) getWatcher() *fsnotify.Watcher {
+	r.watcherMu.RLock()
+	defer r.watcherMu.RUnlock()
+	return r.watcher
+}
+
+// setWatcher installs w as the repo's active watcher and returns whatever
+// watcher it replaced (nil if none), so the caller can close the old one
+// once nothing can still observe it.
+func (r *Repo) setWatcher(w *fsnotify.Watcher) *fsnotify.Watcher {
+	r.watcherMu.Lock()
+	old := r.watcher
+	r.watcher = w
+	r.watcherMu.Unlock()
+	return old
 }
 
 type Monitor struct {
-	watcher    *fsnotify.Watcher
-	lastSync   time.Time
-	logger     *log.Logger
-	cron       *cron.Cron
+	reposMu sync.RWMutex
+	repos   map[string]*Repo
+	logger  *Logger
+
+	cronMu      sync.Mutex
+	cron        *cron.Cron
+	cronEntries map[string]cron.EntryID
+
+	syncer  Syncer
+	syncSem *semaphore
+
+	socketListener net.Listener
+}
+
+// semaphore is a counting semaphore whose limit can be changed while
+// holders are in flight, which a plain buffered channel can't do:
+// replacing the channel on resize would let an in-flight acquire/release
+// pair straddle two different channels and corrupt the count. A resize
+// only changes who future acquires let through; it never touches slots
+// already in use.
+type semaphore struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int
+	inUse int
+}
+
+func newSemaphore(limit int) *semaphore {
+	s := &semaphore{limit: limit}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *semaphore) acquire() {
+	s.mu.Lock()
+	for s.inUse >= s.limit {
+		s.cond.Wait()
+	}
+	s.inUse++
+	s.mu.Unlock()
+}
+
+func (s *semaphore) release() {
+	s.mu.Lock()
+	s.inUse--
+	s.cond.Signal()
+	s.mu.Unlock()
+}
+
+// setLimit changes how many holders the semaphore admits going forward.
+// Waiters are woken so any that now fit under a raised limit can proceed.
+func (s *semaphore) setLimit(limit int) {
+	s.mu.Lock()
+	s.limit = limit
+	s.mu.Unlock()
+	s.cond.Broadcast()
 }
 
 func main() {
+	// nc_monitorctl is shipped as a subcommand of the same binary: it
+	// dials the daemon's control socket instead of running the daemon.
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(runCtl(os.Args[2:]))
+	}
+
+	force := flag.Bool("force", false, "steal the pid file lock if its recorded PID is confirmed dead")
+	flag.Parse()
+
 	// Setup logging
-	logFile, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	logFile, err := os.OpenFile(currentCfg().LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer logFile.Close()
 
 	var logWriter io.Writer = logFile
-	if cfg.Verbose {
+	if currentCfg().Verbose {
 		logWriter = io.MultiWriter(logFile, os.Stdout)
 	}
 
-	logger := log.New(logWriter, "", log.LstdFlags|log.Lshortfile)
+	level := parseLevel(currentCfg().LogLevel)
+	if currentCfg().Verbose && level > LevelDebug {
+		level = LevelDebug
+	}
+	logger := NewLogger(logWriter, level, currentCfg().LogRingSize)
 
 	// Check for existing instance
-	if err := checkInstance(); err != nil {
-		logger.Fatal(err)
+	lock, err := acquireInstanceLock(currentCfg().PidFile, *force)
+	if err != nil {
+		logger.Fatal("main", "%v", err)
 	}
-	defer os.Remove(cfg.PidFile)
+	defer lock.Release()
 
 	// Create monitor
 	monitor := &Monitor{
-		logger: logger,
+		logger:      logger,
+		repos:       make(map[string]*Repo),
+		cronEntries: make(map[string]cron.EntryID),
+		syncSem:     newSemaphore(currentCfg().MaxConcurrentSyncs),
+	}
+	for _, rc := range currentCfg().Repos {
+		monitor.repos[rc.Name] = newRepo(rc)
+	}
+
+	syncer, err := NewSyncer(logger)
+	if err != nil {
+		logger.Fatal("main", "%v", err)
 	}
+	monitor.syncer = syncer
+
+	// Initialize watchers
+	monitor.initWatchers()
+	defer monitor.closeWatchers()
 
-	// Initialize watcher
-	if err := monitor.initWatcher(); err != nil {
-		logger.Fatal(err)
+	if err := monitor.serveControlSocket(); err != nil {
+		logger.Warn("main", "failed to start control socket: %v", err)
 	}
-	defer monitor.watcher.Close()
+
+	monitor.watchConfigReload()
 
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
@@ -146,160 +468,351 @@ func main() {
 		os.Exit(0)
 	}()
 
-	// Initial sync
-	if err := monitor.sync(); err != nil {
-		logger.Println("Initial sync failed:", err)
-	}
+	// Initial sync of every repo, at most max_concurrent_syncs at once
+	monitor.syncAll()
 
 	// Start periodic sync
 	monitor.startPeriodicSync()
 
-	// Start watching for changes
-	monitor.watch()
+	// Start watching for changes. Each repo watches on its own goroutine
+	// now, so main blocks here for good; shutdown happens via the signal
+	// handler's os.Exit above.
+	monitor.runWatchLoops()
+	select {}
+}
+
+func (m *Monitor) repo(name string) (*Repo, bool) {
+	m.reposMu.RLock()
+	defer m.reposMu.RUnlock()
+	r, ok := m.repos[name]
+	return r, ok
+}
+
+// repoNames returns the configured repo names in sorted order, so status
+// output and fan-out operations are deterministic.
+func (m *Monitor) repoNames() []string {
+	m.reposMu.RLock()
+	defer m.reposMu.RUnlock()
+	names := make([]string, 0, len(m.repos))
+	for name := range m.repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func (m *Monitor) initWatcher() error {
-	if cfg.Verbose {
-		m.logger.Println("Initializing file watcher...")
+func (m *Monitor) initWatchers() {
+	for _, name := range m.repoNames() {
+		repo, ok := m.repo(name)
+		if !ok {
+			continue
+		}
+		if err := m.initRepoWatcher(repo); err != nil {
+			m.logger.Error("watcher", "[%s] failed to init watcher: %v", name, err)
+		}
 	}
+}
+
+func (m *Monitor) closeWatchers() {
+	for _, name := range m.repoNames() {
+		repo, ok := m.repo(name)
+		if ok {
+			if w := repo.getWatcher(); w != nil {
+				w.Close()
+			}
+		}
+	}
+}
+
+func (m *Monitor) initRepoWatcher(repo *Repo) error {
+	m.logger.Debug("watcher", "[%s] initializing file watcher...", repo.name)
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %v", err)
 	}
-	m.watcher = watcher
 
-	// Expand home directory path
-	dir := os.ExpandEnv(cfg.WatchDir)
-	if cfg.Verbose {
-		m.logger.Printf("Watching directory: %s", dir)
-	}
+	rc := repo.config()
+	dir := os.ExpandEnv(rc.WatchDir)
+	m.logger.Debug("watcher", "[%s] watching directory: %s", repo.name, dir)
 
-	// Walk through directory tree and add watches
 	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() && !shouldIgnore(path) {
+		if info.IsDir() && !shouldIgnore(path, rc.IgnorePatterns) {
 			return watcher.Add(path)
 		}
 		return nil
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to walk directory: %v", err)
+		watcher.Close()
+		return fmt.Errorf("failed to walk directory %s: %v", dir, err)
 	}
 
+	if old := repo.setWatcher(watcher); old != nil {
+		old.Close()
+	}
 	return nil
 }
 
-func (m *Monitor) startPeriodicSync() {
-	if cfg.Verbose {
-		m.logger.Printf("Setting up periodic sync with interval: %s", cfg.SyncInterval)
+// syncAll runs an initial sync of every repo, fanned out across
+// goroutines but still bounded by syncSem.
+func (m *Monitor) syncAll() {
+	var wg sync.WaitGroup
+	for _, name := range m.repoNames() {
+		name := name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.syncRepo(name); err != nil {
+				m.logger.Warn("main", "[%s] initial sync failed: %v", name, err)
+			}
+		}()
 	}
+	wg.Wait()
+}
+
+// startPeriodicSync registers one cron entry per repo, so each repo can
+// carry its own sync_interval.
+func (m *Monitor) startPeriodicSync() {
+	m.cronMu.Lock()
 	m.cron = cron.New()
-	_, err := m.cron.AddFunc(cfg.SyncInterval, func() {
-		if err := m.sync(); err != nil {
-			m.logger.Println("Periodic sync failed:", err)
+	m.cronEntries = make(map[string]cron.EntryID)
+	m.cronMu.Unlock()
+
+	for _, name := range m.repoNames() {
+		repo, ok := m.repo(name)
+		if !ok {
+			continue
+		}
+		m.scheduleRepoCron(name, repo)
+	}
+
+	m.cronMu.Lock()
+	m.cron.Start()
+	m.cronMu.Unlock()
+}
+
+// scheduleRepoCron and removeCronEntry hold cronMu while they touch
+// m.cron/m.cronEntries, as do startPeriodicSync, cleanup and
+// nextScheduledSync: both the viper reload goroutine (via
+// addRepo/removeRepo/updateRepo) and the control-socket goroutine (via
+// nextScheduledSync) reach these fields, so every access goes through
+// cronMu.
+func (m *Monitor) scheduleRepoCron(name string, repo *Repo) {
+	m.logger.Debug("cron", "[%s] scheduling periodic sync with interval: %s", name, repo.config().SyncInterval)
+
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+	if m.cron == nil {
+		return
+	}
+	id, err := m.cron.AddFunc(repo.config().SyncInterval, func() {
+		if err := m.syncRepo(name); err != nil {
+			m.logger.Warn("cron", "[%s] periodic sync failed: %v", name, err)
 		}
 	})
 	if err != nil {
-		m.logger.Println("Failed to start periodic sync:", err)
+		m.logger.Error("cron", "[%s] failed to schedule periodic sync: %v", name, err)
 		return
 	}
-	m.cron.Start()
+	m.cronEntries[name] = id
+}
+
+// removeCronEntry unregisters name's cron entry, if any. A no-op if
+// periodic sync hasn't been started.
+func (m *Monitor) removeCronEntry(name string) {
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+	if m.cron == nil {
+		return
+	}
+	if id, ok := m.cronEntries[name]; ok {
+		m.cron.Remove(id)
+		delete(m.cronEntries, name)
+	}
+}
+
+func (m *Monitor) runWatchLoops() {
+	for _, name := range m.repoNames() {
+		repo, ok := m.repo(name)
+		if !ok {
+			continue
+		}
+		go m.runRepoWatchLoop(name, repo)
+	}
+}
+
+// runRepoWatchLoop keeps a repo watched for as long as it exists. A single
+// watchRepo call ends whenever its watcher is closed, which happens both on
+// a deliberate watcher rebuild (updateRepo) and on teardown (removeRepo);
+// the loop restarts it in the first case and exits in the second, which it
+// tells apart via repo.done rather than by guessing from the nil-ness of
+// the watcher field.
+func (m *Monitor) runRepoWatchLoop(name string, repo *Repo) {
+	for {
+		select {
+		case <-repo.done:
+			return
+		default:
+		}
+		if repo.getWatcher() == nil {
+			return
+		}
+		m.watchRepo(name, repo)
+	}
 }
 
-func (m *Monitor) watch() {
-	if cfg.Verbose {
-		m.logger.Println("Starting file watcher...")
+// watchRepo coalesces one repo's fsnotify events into its pending set and
+// debounces them: the timer resets on every new event and only fires
+// once the stream has been quiet for the repo's SyncCooldown, at which
+// point a single sync runs for the whole coalesced batch.
+func (m *Monitor) watchRepo(name string, repo *Repo) {
+	watcher := repo.getWatcher()
+	if watcher == nil {
+		return
+	}
+
+	m.logger.Debug("watcher", "[%s] starting file watcher...", name)
+
+	debounce := time.NewTimer(repo.config().SyncCooldown)
+	if !debounce.Stop() {
+		<-debounce.C
 	}
+
 	for {
 		select {
-		case event, ok := <-m.watcher.Events:
+		case <-repo.done:
+			return
+
+		case event, ok := <-watcher.Events:
 			if !ok {
 				return
 			}
 
-			if shouldIgnore(event.Name) {
-				m.logger.Printf("Ignoring event: %s", event)
+			if shouldIgnore(event.Name, repo.config().IgnorePatterns) {
+				m.logger.Debug("watcher", "[%s] ignoring event: %s", name, event)
 				continue
 			}
 
-			// Check cooldown
-			if time.Since(m.lastSync) < cfg.SyncCooldown {
-				m.logger.Println("Sync cooldown active, skipping...")
-				continue
-			}
+			m.handleWatchTree(name, watcher, event)
 
-			m.logger.Printf("Detected change: %s", event)
+			repo.pendingMu.Lock()
+			repo.pending[event.Name] = struct{}{}
+			repo.pendingMu.Unlock()
 
-			if err := m.sync(); err != nil {
-				m.logger.Println("Sync failed:", err)
-			}
+			m.logger.Debug("watcher", "[%s] queued change: %s", name, event)
+			debounce.Reset(repo.config().SyncCooldown)
 
-		case err, ok := <-m.watcher.Errors:
+		case err, ok := <-watcher.Errors:
 			if !ok {
 				return
 			}
-			m.logger.Println("Watcher error:", err)
+			m.logger.Error("watcher", "[%s] watcher error: %v", name, err)
+
+		case <-debounce.C:
+			m.flushPending(name, repo)
+		}
+	}
+}
+
+// handleWatchTree keeps the recursive watch tree correct as directories
+// are created and removed: newly created directories are added so their
+// contents start being watched, and removed directories are dropped so
+// the watcher doesn't accumulate stale entries.
+func (m *Monitor) handleWatchTree(name string, watcher *fsnotify.Watcher, event fsnotify.Event) {
+	switch {
+	case event.Op&fsnotify.Create != 0:
+		info, err := os.Stat(event.Name)
+		if err == nil && info.IsDir() {
+			if err := watcher.Add(event.Name); err != nil {
+				m.logger.Warn("watcher", "[%s] failed to watch new directory %s: %v", name, event.Name, err)
+			} else {
+				m.logger.Debug("watcher", "[%s] watching new directory: %s", name, event.Name)
+			}
 		}
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		// Removing a watch on a path fsnotify isn't watching (e.g. a
+		// plain file) is a harmless no-op, so the error is ignored.
+		_ = watcher.Remove(event.Name)
+	}
+}
+
+// flushPending runs a single sync covering every path queued since the
+// last flush, then clears the pending set.
+func (m *Monitor) flushPending(name string, repo *Repo) {
+	repo.pendingMu.Lock()
+	paths := make([]string, 0, len(repo.pending))
+	for p := range repo.pending {
+		paths = append(paths, p)
+	}
+	repo.pending = make(map[string]struct{})
+	repo.pendingMu.Unlock()
+
+	if len(paths) == 0 {
+		return
+	}
+
+	m.logger.Info("watcher", "[%s] detected %d changed path(s), syncing: %v", name, len(paths), paths)
+
+	if err := m.syncRepo(name); err != nil {
+		m.logger.Error("watcher", "[%s] sync failed: %v", name, err)
 	}
 }
 
-func (m *Monitor) sync() error {
-	if cfg.Verbose {
-		m.logger.Println("Starting Nextcloud sync...")
-		m.logger.Printf("Sync parameters - RemoteDir: %s, WatchDir: %s, URL: %s", 
-			cfg.RemoteDir, cfg.WatchDir, cfg.NextcloudURL)
+// syncRepo runs one sync pass for the named repo, bounded by syncSem so
+// at most cfg.MaxConcurrentSyncs repos sync at once across the daemon.
+func (m *Monitor) syncRepo(name string) error {
+	repo, ok := m.repo(name)
+	if !ok {
+		return fmt.Errorf("unknown repo %q", name)
 	}
 
-	// Get password from pass command
-	password := os.ExpandEnv(cfg.Password)
+	m.syncSem.acquire()
+	defer m.syncSem.release()
 
-	// Build sync command
-	cmd := exec.Command("nextcloudcmd",
-		"--path", cfg.RemoteDir,
-		os.ExpandEnv(cfg.WatchDir),
-		fmt.Sprintf("https://%s:%s@%s", cfg.Username, password, cfg.NextcloudURL),
-	)
+	rc := repo.config()
+	m.logger.Debug("syncer", "[%s] starting sync...", name)
+	m.logger.Debug("syncer", "[%s] sync parameters - RemoteDir: %s, WatchDir: %s, URL: %s",
+		name, rc.RemoteDir, rc.WatchDir, rc.NextcloudURL)
 
-	// Log command if verbose
-	if cfg.Verbose {
-		m.logger.Printf("Sync command: %v", cmd.Args)
+	startedAt := time.Now()
+	report, syncErr := m.syncer.Sync(context.Background(), rc)
+
+	event := SyncEvent{
+		Repo:         name,
+		StartedAt:    startedAt,
+		Duration:     report.Duration,
+		FilesChanged: report.changedFiles(),
+		Err:          syncErr,
 	}
+	notifyAll(context.Background(), buildNotifiers(currentCfg().Notifiers), event, m.logger)
 
-	// Run command
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("sync failed: %v", err)
+	if syncErr != nil {
+		return fmt.Errorf("sync failed: %v", syncErr)
 	}
 
-	m.lastSync = time.Now()
-	m.logger.Println("Sync completed successfully")
-	notify("Nextcloud Sync Done")
+	repo.lastSync = time.Now()
+	m.logger.Info("syncer", "[%s] sync completed successfully (%s)", name, report)
 	return nil
 }
 
 func (m *Monitor) cleanup() {
+	m.cronMu.Lock()
 	if m.cron != nil {
 		m.cron.Stop()
 	}
-	m.logger.Println("Stopping monitor...")
-}
-
-func checkInstance() error {
-	pidData, err := os.ReadFile(cfg.PidFile)
-	if err == nil {
-		pid := strings.TrimSpace(string(pidData))
-		if _, err := os.Stat(fmt.Sprintf("/proc/%s", pid)); err == nil {
-			return fmt.Errorf("another instance is already running (PID: %s)", pid)
-		}
+	m.cronMu.Unlock()
+	m.closeWatchers()
+	if m.socketListener != nil {
+		m.socketListener.Close()
+		os.Remove(currentCfg().ControlSocket)
 	}
-
-	return os.WriteFile(cfg.PidFile, []byte(fmt.Sprintf("%d", os.Getpid())), 0644)
+	m.logger.Info("main", "Stopping monitor...")
 }
 
-func shouldIgnore(path string) bool {
-	for _, pattern := range cfg.IgnorePatterns {
+func shouldIgnore(path string, patterns []string) bool {
+	for _, pattern := range patterns {
 		matched, err := filepath.Match(pattern, filepath.Base(path))
 		if err == nil && matched {
 			return true
@@ -307,10 +820,3 @@ func shouldIgnore(path string) bool {
 	}
 	return false
 }
-
-func notify(message string) {
-	if os.Getenv("DISPLAY") != "" {
-		cmd := exec.Command("dunstify", message)
-		_ = cmd.Run()
-	}
-}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyncEvent describes the outcome of one sync pass. It's passed to every
+// configured Notifier for both the success and failure paths.
+type SyncEvent struct {
+	Repo         string
+	StartedAt    time.Time
+	Duration     time.Duration
+	FilesChanged []string
+	Err          error
+}
+
+func (e SyncEvent) success() bool { return e.Err == nil }
+
+// summary renders a git-style short summary of changed files, e.g.
+// "2 file(s) changed: notes.org, todo.org".
+func (e SyncEvent) summary() string {
+	if len(e.FilesChanged) == 0 {
+		return "no files changed"
+	}
+	return fmt.Sprintf("%d file(s) changed: %s", len(e.FilesChanged), strings.Join(e.FilesChanged, ", "))
+}
+
+// Notifier is a sync-completion notification backend.
+type Notifier interface {
+	Notify(ctx context.Context, event SyncEvent) error
+}
+
+// notifierHTTPTimeout bounds how long the webhook and ntfy notifiers will
+// wait on a slow or hung endpoint. notifyAll runs from inside syncRepo
+// while it still holds a syncSem slot, so an unbounded request here would
+// stall that slot indefinitely.
+const notifierHTTPTimeout = 10 * time.Second
+
+var notifierHTTPClient = &http.Client{Timeout: notifierHTTPTimeout}
+
+// NotifierConfig is one entry of the `notifiers:` yaml list.
+type NotifierConfig struct {
+	Type     string   `mapstructure:"type"`
+	URL      string   `mapstructure:"url"`
+	Topic    string   `mapstructure:"topic"`
+	SMTPAddr string   `mapstructure:"smtp_addr"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	On       []string `mapstructure:"on"`
+}
+
+// appliesTo reports whether this entry wants a notification for an
+// event with the given outcome. An empty `on` list means both.
+func (c NotifierConfig) appliesTo(success bool) bool {
+	if len(c.On) == 0 {
+		return true
+	}
+	want := "failure"
+	if success {
+		want = "success"
+	}
+	for _, o := range c.On {
+		if o == want {
+			return true
+		}
+	}
+	return false
+}
+
+// notifierEntry pairs a built Notifier with the config that selected it,
+// so fan-out can consult On without the Notifier needing to know about
+// config at all.
+type notifierEntry struct {
+	cfg      NotifierConfig
+	notifier Notifier
+}
+
+// buildNotifiers turns the configured list into ready-to-use notifiers.
+// An empty list falls back to the historical desktop-only behavior.
+func buildNotifiers(configs []NotifierConfig) []notifierEntry {
+	if len(configs) == 0 {
+		configs = []NotifierConfig{{Type: "desktop"}}
+	}
+
+	entries := make([]notifierEntry, 0, len(configs))
+	for _, c := range configs {
+		var n Notifier
+		switch c.Type {
+		case "desktop":
+			n = desktopNotifier{}
+		case "webhook":
+			n = webhookNotifier{url: c.URL}
+		case "ntfy":
+			n = ntfyNotifier{topic: c.Topic}
+		case "email", "smtp":
+			n = smtpNotifier{addr: c.SMTPAddr, from: c.From, to: c.To}
+		default:
+			continue
+		}
+		entries = append(entries, notifierEntry{cfg: c, notifier: n})
+	}
+	return entries
+}
+
+// notifyAll fans a SyncEvent out to every notifier whose `on` filter
+// matches, logging (never failing the sync on) individual errors.
+func notifyAll(ctx context.Context, entries []notifierEntry, event SyncEvent, logger *Logger) {
+	for _, e := range entries {
+		if !e.cfg.appliesTo(event.success()) {
+			continue
+		}
+		if err := e.notifier.Notify(ctx, event); err != nil {
+			logger.Warn("notifier", "%s notifier failed: %v", e.cfg.Type, err)
+		}
+	}
+}
+
+// desktopNotifier preserves the original dunstify/notify-send behavior,
+// a no-op on headless servers where DISPLAY is empty.
+type desktopNotifier struct{}
+
+func (desktopNotifier) Notify(ctx context.Context, event SyncEvent) error {
+	if os.Getenv("DISPLAY") == "" {
+		return nil
+	}
+	message := fmt.Sprintf("Nextcloud sync %s (%s)", outcome(event), event.summary())
+	if err := exec.CommandContext(ctx, "dunstify", message).Run(); err != nil {
+		return exec.CommandContext(ctx, "notify-send", message).Run()
+	}
+	return nil
+}
+
+// webhookNotifier POSTs a JSON payload to a generic HTTP endpoint.
+type webhookNotifier struct {
+	url string
+}
+
+func (w webhookNotifier) Notify(ctx context.Context, event SyncEvent) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":         outcome(event),
+		"repo":          event.Repo,
+		"started_at":    event.StartedAt.Format(time.RFC3339),
+		"duration_ms":   event.Duration.Milliseconds(),
+		"files_changed": event.FilesChanged,
+		"error":         errString(event.Err),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifierHTTPTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notifierHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ntfyNotifier publishes a plain-text message to an ntfy.sh topic.
+type ntfyNotifier struct {
+	topic string
+}
+
+func (n ntfyNotifier) Notify(ctx context.Context, event SyncEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, notifierHTTPTimeout)
+	defer cancel()
+
+	message := fmt.Sprintf("Nextcloud sync %s for %s: %s", outcome(event), event.Repo, event.summary())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://ntfy.sh/"+n.topic, strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	resp, err := notifierHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("ntfy returned %s", resp.Status)
+	}
+	return nil
+}
+
+// smtpNotifier emails the sync outcome via a plain SMTP relay, for
+// headless servers that have one available.
+type smtpNotifier struct {
+	addr string
+	from string
+	to   []string
+}
+
+func (s smtpNotifier) Notify(ctx context.Context, event SyncEvent) error {
+	subject := fmt.Sprintf("Nextcloud sync %s: %s", outcome(event), event.Repo)
+	body := fmt.Sprintf("%s\nduration: %s\n", event.summary(), event.Duration)
+	if event.Err != nil {
+		body += fmt.Sprintf("error: %v\n", event.Err)
+	}
+
+	msg := "From: " + s.from + "\r\n" +
+		"To: " + strings.Join(s.to, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n\r\n" +
+		body
+
+	host, _, err := splitSMTPHost(s.addr)
+	if err != nil {
+		return err
+	}
+
+	// smtp.SendMail has no timeout of its own, and notifyAll runs from
+	// inside syncRepo while it still holds a syncSem slot: dial and bound
+	// the whole conversation with notifierHTTPTimeout so a hung relay
+	// can't stall a concurrency slot indefinitely.
+	conn, err := net.DialTimeout("tcp", s.addr, notifierHTTPTimeout)
+	if err != nil {
+		return fmt.Errorf("smtp dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(notifierHTTPTimeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("smtp client: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("smtp starttls: %v", err)
+		}
+	}
+
+	auth := smtp.PlainAuth("", s.from, "", host)
+	if ok, _ := client.Extension("AUTH"); ok {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %v", err)
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func splitSMTPHost(addr string) (string, string, error) {
+	host, port, found := strings.Cut(addr, ":")
+	if !found {
+		return "", "", fmt.Errorf("smtp_addr %q must be host:port", addr)
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", "", fmt.Errorf("smtp_addr %q has a non-numeric port: %v", addr, err)
+	}
+	return host, port, nil
+}
+
+func outcome(event SyncEvent) string {
+	if event.success() {
+		return "success"
+	}
+	return "failure"
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
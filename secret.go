@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Resolver resolves a secret reference into its plaintext value. The
+// config's password/username accept URI-style prefixes so rotated
+// credentials in pass/a file/env can take effect without restarting the
+// daemon: resolution happens lazily on every sync rather than once at
+// startup.
+type Resolver interface {
+	Resolve() (string, error)
+}
+
+// NewResolver builds the Resolver for a secret reference. Recognized
+// prefixes are pass:, file:, env: and plain:; anything without a
+// recognized prefix is treated as plain:<value> for backward
+// compatibility with existing plaintext configs.
+func NewResolver(ref string) Resolver {
+	switch {
+	case strings.HasPrefix(ref, "pass:"):
+		return passResolver{entry: strings.TrimPrefix(ref, "pass:")}
+	case strings.HasPrefix(ref, "file:"):
+		return fileResolver{path: strings.TrimPrefix(ref, "file:")}
+	case strings.HasPrefix(ref, "env:"):
+		return envResolver{name: strings.TrimPrefix(ref, "env:")}
+	case strings.HasPrefix(ref, "plain:"):
+		return plainResolver{value: strings.TrimPrefix(ref, "plain:")}
+	default:
+		return plainResolver{value: ref}
+	}
+}
+
+// passResolver shells out to `pass show <entry>` and takes its first
+// line, matching how pass(1) stores a password as line one of an entry.
+type passResolver struct {
+	entry string
+}
+
+func (r passResolver) Resolve() (string, error) {
+	out, err := exec.Command("pass", "show", r.entry).Output()
+	if err != nil {
+		return "", fmt.Errorf("pass show %s: %v", r.entry, err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimRight(line, "\r"), nil
+}
+
+// fileResolver reads and trims a secret from a file, refusing to do so
+// if the file grants any permission to group or other (0600 and 0400 pass,
+// 0640 does not) so a rotated credential can't be read by other local
+// users.
+type fileResolver struct {
+	path string
+}
+
+func (r fileResolver) Resolve() (string, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return "", fmt.Errorf("stat %s: %v", r.path, err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s must not be accessible by group/other (mode %o)", r.path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %v", r.path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// envResolver reads a secret from an environment variable.
+type envResolver struct {
+	name string
+}
+
+func (r envResolver) Resolve() (string, error) {
+	v, ok := os.LookupEnv(r.name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", r.name)
+	}
+	return v, nil
+}
+
+// plainResolver is a literal value, still expanded against the
+// environment for backward compatibility with the old cfg.Password
+// behavior.
+type plainResolver struct {
+	value string
+}
+
+func (r plainResolver) Resolve() (string, error) {
+	return os.ExpandEnv(r.value), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// serveControlSocket listens on cfg.ControlSocket and accepts newline
+// commands: status, sync, log, reload, stop. It's how nc_monitorctl talks
+// to a running daemon.
+func (m *Monitor) serveControlSocket() error {
+	socketPath := os.ExpandEnv(currentCfg().ControlSocket)
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		return fmt.Errorf("failed to create control socket directory: %v", err)
+	}
+	// A stale socket left behind by a crashed daemon would otherwise
+	// make the new Listen fail with "address already in use".
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale control socket: %v", err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket: %v", err)
+	}
+	m.socketListener = listener
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go m.handleControlConn(conn)
+		}
+	}()
+
+	m.logger.Debug("control", "listening on %s", socketPath)
+	return nil
+}
+
+func (m *Monitor) handleControlConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd := strings.TrimSpace(scanner.Text())
+		if cmd == "" {
+			continue
+		}
+		m.runControlCommand(conn, cmd)
+	}
+}
+
+func (m *Monitor) runControlCommand(conn net.Conn, cmd string) {
+	fields := strings.Fields(cmd)
+	switch fields[0] {
+	case "status":
+		m.writeStatus(conn)
+	case "sync":
+		m.runSyncCommand(conn, fields[1:])
+	case "log":
+		for _, line := range m.logger.Lines() {
+			fmt.Fprintln(conn, line)
+		}
+	case "reload":
+		m.reloadConfig()
+		fmt.Fprintln(conn, "reload complete")
+	case "stop":
+		fmt.Fprintln(conn, "stopping")
+		go func() {
+			m.cleanup()
+			os.Exit(0)
+		}()
+	default:
+		fmt.Fprintf(conn, "unknown command %q (want status|sync [repo]|log|reload|stop)\n", fields[0])
+	}
+}
+
+// runSyncCommand syncs the named repos, or every repo if none are given.
+func (m *Monitor) runSyncCommand(conn net.Conn, names []string) {
+	if len(names) == 0 {
+		names = m.repoNames()
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		fmt.Fprintf(conn, "syncing %s...\n", name)
+		if err := m.syncRepo(name); err != nil {
+			fmt.Fprintf(conn, "%s: sync failed: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(conn, "%s: sync complete\n", name)
+	}
+}
+
+// writeStatus renders a tabwriter-formatted status table with one row
+// per repo: last sync time, next scheduled sync, pending event count,
+// and cooldown state.
+func (m *Monitor) writeStatus(conn net.Conn) {
+	tw := tabwriter.NewWriter(conn, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "repo\tlast sync\tnext sync\tpending\tcooldown active\n")
+
+	names := m.repoNames()
+	sort.Strings(names)
+
+	for _, name := range names {
+		repo, ok := m.repo(name)
+		if !ok {
+			continue
+		}
+
+		lastSync := "never"
+		if !repo.lastSync.IsZero() {
+			lastSync = repo.lastSync.Format(time.RFC3339)
+		}
+
+		nextSync := "not scheduled"
+		if next := m.nextScheduledSync(name); !next.IsZero() {
+			nextSync = next.Format(time.RFC3339)
+		}
+
+		cooldownActive := "no"
+		if time.Since(repo.lastSync) < repo.config().SyncCooldown {
+			cooldownActive = "yes"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", name, lastSync, nextSync, m.pendingCount(repo), cooldownActive)
+	}
+	tw.Flush()
+}
+
+func (m *Monitor) pendingCount(repo *Repo) int {
+	repo.pendingMu.Lock()
+	defer repo.pendingMu.Unlock()
+	return len(repo.pending)
+}
+
+func (m *Monitor) nextScheduledSync(name string) time.Time {
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+	if m.cron == nil {
+		return time.Time{}
+	}
+	id, ok := m.cronEntries[name]
+	if !ok {
+		return time.Time{}
+	}
+	return m.cron.Entry(id).Next
+}
+
+// runCtl implements the nc_monitorctl subcommand: it dials the control
+// socket, sends the given command, and prints the response.
+func runCtl(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: nc_monitor ctl <status|sync [repo]|log|reload|stop>")
+		return 1
+	}
+
+	conn, err := net.DialTimeout("unix", os.ExpandEnv(currentCfg().ControlSocket), 3*time.Second)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to control socket: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	fmt.Fprintln(conn, strings.Join(args, " "))
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fmt.Println(scanner.Text())
+	}
+	return 0
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/studio-b12/gowebdav"
+	bolt "go.etcd.io/bbolt"
+)
+
+// SyncReport summarizes what a single Sync call did.
+type SyncReport struct {
+	Uploaded   []string
+	Downloaded []string
+	Deleted    []string
+	Conflicted []string
+	Duration   time.Duration
+}
+
+func (r SyncReport) String() string {
+	return fmt.Sprintf("uploaded=%d downloaded=%d deleted=%d conflicted=%d duration=%s",
+		len(r.Uploaded), len(r.Downloaded), len(r.Deleted), len(r.Conflicted), r.Duration)
+}
+
+// changedFiles flattens every path touched by the sync, for notifiers
+// that want a git-style summary of what changed.
+func (r SyncReport) changedFiles() []string {
+	out := make([]string, 0, len(r.Uploaded)+len(r.Downloaded)+len(r.Deleted)+len(r.Conflicted))
+	out = append(out, r.Uploaded...)
+	out = append(out, r.Downloaded...)
+	out = append(out, r.Deleted...)
+	out = append(out, r.Conflicted...)
+	return out
+}
+
+// Syncer drives one sync pass between a repo's local watch directory and
+// its remote Nextcloud instance. There are two implementations:
+// externalSyncer shells out to nextcloudcmd (the historical behavior) and
+// nativeSyncer talks WebDAV directly. Selected via cfg.SyncBackend. A
+// single Syncer is shared across all repos, so implementations must be
+// safe to call concurrently for different repos.
+type Syncer interface {
+	Sync(ctx context.Context, repo RepoConfig) (SyncReport, error)
+}
+
+// NewSyncer builds the Syncer selected by cfg.SyncBackend.
+func NewSyncer(logger *Logger) (Syncer, error) {
+	switch currentCfg().SyncBackend {
+	case "", "external":
+		return &externalSyncer{logger: logger}, nil
+	case "native":
+		return newNativeSyncer(logger)
+	default:
+		return nil, fmt.Errorf("unknown sync_backend %q (want external or native)", currentCfg().SyncBackend)
+	}
+}
+
+// externalSyncer preserves the original nextcloudcmd-based behavior.
+type externalSyncer struct {
+	logger *Logger
+}
+
+func (s *externalSyncer) Sync(ctx context.Context, repo RepoConfig) (SyncReport, error) {
+	start := time.Now()
+
+	username, password, err := resolveCredentials(repo)
+	if err != nil {
+		return SyncReport{Duration: time.Since(start)}, err
+	}
+
+	cmd := exec.CommandContext(ctx, "nextcloudcmd",
+		"--path", repo.RemoteDir,
+		os.ExpandEnv(repo.WatchDir),
+		fmt.Sprintf("https://%s:%s@%s", username, password, repo.NextcloudURL),
+	)
+
+	// Never log cmd.Args directly: it embeds the resolved password.
+	s.logger.Debug("syncer", "[%s] sync command: nextcloudcmd --path %s %s https://%s:***@%s",
+		repo.Name, repo.RemoteDir, os.ExpandEnv(repo.WatchDir), username, repo.NextcloudURL)
+
+	if err := cmd.Run(); err != nil {
+		return SyncReport{Duration: time.Since(start)}, fmt.Errorf("sync failed: %v", err)
+	}
+
+	return SyncReport{Duration: time.Since(start)}, nil
+}
+
+// resolveCredentials resolves repo.Username/repo.Password through the
+// secret package on every call so rotated credentials (pass entry
+// updated, secret file rewritten, env var changed) take effect on the
+// next sync without restarting the daemon.
+func resolveCredentials(repo RepoConfig) (username, password string, err error) {
+	username, err = NewResolver(repo.Username).Resolve()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve username: %v", err)
+	}
+	password, err = NewResolver(repo.Password).Resolve()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve password: %v", err)
+	}
+	return username, password, nil
+}
+
+// fileState is what we remember about a file between sync passes.
+type fileState struct {
+	ETag     string `json:"etag"`
+	MTime    int64  `json:"mtime"`
+	Size     int64  `json:"size"`
+	RemoteID string `json:"remote_id"`
+}
+
+// bucketName returns the bbolt bucket holding a repo's file state. Each
+// repo gets its own bucket so multiple repos can share one state_db_path
+// without clobbering each other's history.
+func bucketName(repoName string) []byte {
+	return []byte("files/" + repoName)
+}
+
+// nativeSyncer talks WebDAV directly instead of shelling out to
+// nextcloudcmd, keeping its own bbolt state database mapping relative
+// paths to the last known {etag, mtime, size, remoteID}. A single
+// nativeSyncer is shared across all repos and may be called concurrently
+// for different repos, so it keeps no per-sync state on the struct
+// itself (the WebDAV client is built fresh per call).
+type nativeSyncer struct {
+	logger *Logger
+	db     *bolt.DB
+}
+
+func newNativeSyncer(logger *Logger) (*nativeSyncer, error) {
+	dbPath := os.ExpandEnv(currentCfg().StateDBPath)
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state db directory: %v", err)
+	}
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state db: %v", err)
+	}
+
+	return &nativeSyncer{logger: logger, db: db}, nil
+}
+
+func (s *nativeSyncer) Close() error {
+	return s.db.Close()
+}
+
+func (s *nativeSyncer) Sync(ctx context.Context, repo RepoConfig) (SyncReport, error) {
+	start := time.Now()
+	report := SyncReport{}
+
+	username, password, err := resolveCredentials(repo)
+	if err != nil {
+		return report, err
+	}
+	client := gowebdav.NewClient(fmt.Sprintf("https://%s/remote.php/dav/files/%s", repo.NextcloudURL, username), username, password)
+
+	localDir := os.ExpandEnv(repo.WatchDir)
+
+	saved, err := s.loadState(repo.Name)
+	if err != nil {
+		return report, fmt.Errorf("failed to load sync state: %v", err)
+	}
+
+	remote, err := s.remoteState(ctx, client, repo.RemoteDir)
+	if err != nil {
+		return report, fmt.Errorf("failed to enumerate remote state: %v", err)
+	}
+
+	local, err := s.localState(localDir, repo.IgnorePatterns)
+	if err != nil {
+		return report, fmt.Errorf("failed to walk local directory: %v", err)
+	}
+
+	next := map[string]fileState{}
+
+	// Files present locally: upload if new/changed, unless the remote
+	// also changed since our last known state (a conflict). localChanged
+	// and remoteChanged both require a known baseline, so a file that
+	// already exists on both sides the first time we see it (e.g.
+	// migrating a dir that was already synced by nextcloudcmd into
+	// state_db_path) is never treated as a conflict purely for lack of
+	// history.
+	for relPath, l := range local {
+		r, onRemote := remote[relPath]
+		p, known := saved[relPath]
+
+		localChanged := known && (l.Size != p.Size || l.MTime != p.MTime)
+		remoteChanged := known && onRemote && r.ETag != p.ETag
+
+		switch {
+		case localChanged && remoteChanged:
+			conflictName := conflictFileName(relPath)
+			if err := os.Rename(filepath.Join(localDir, relPath), filepath.Join(localDir, conflictName)); err != nil {
+				s.logger.Warn("syncer", "[%s] failed to rename conflicting file %s: %v", repo.Name, relPath, err)
+				continue
+			}
+			report.Conflicted = append(report.Conflicted, relPath)
+			if err := s.download(ctx, client, localDir, repo.RemoteDir, relPath, r.MTime); err != nil {
+				s.logger.Warn("syncer", "[%s] failed to download %s after conflict: %v", repo.Name, relPath, err)
+				continue
+			}
+			next[relPath] = r
+		case !known && onRemote && l.Size == r.Size:
+			// No baseline, but the file already matches the remote copy:
+			// adopt the remote's state as our new baseline instead of
+			// re-transferring a file that's already in sync.
+			next[relPath] = r
+		case !known:
+			// No baseline, and either the file doesn't exist remotely yet
+			// or the sizes disagree with nothing to arbitrate between
+			// them: treat the local copy as authoritative.
+			if err := s.upload(ctx, client, localDir, repo.RemoteDir, relPath); err != nil {
+				s.logger.Warn("syncer", "[%s] failed to upload %s: %v", repo.Name, relPath, err)
+				continue
+			}
+			report.Uploaded = append(report.Uploaded, relPath)
+			etag, err := s.statETag(client, path.Join(repo.RemoteDir, relPath))
+			if err != nil {
+				s.logger.Warn("syncer", "[%s] failed to re-stat %s after upload: %v", repo.Name, relPath, err)
+			}
+			l.ETag = etag
+			next[relPath] = l
+		case localChanged:
+			if err := s.upload(ctx, client, localDir, repo.RemoteDir, relPath); err != nil {
+				s.logger.Warn("syncer", "[%s] failed to upload %s: %v", repo.Name, relPath, err)
+				next[relPath] = p
+				continue
+			}
+			report.Uploaded = append(report.Uploaded, relPath)
+			etag, err := s.statETag(client, path.Join(repo.RemoteDir, relPath))
+			if err != nil {
+				s.logger.Warn("syncer", "[%s] failed to re-stat %s after upload: %v", repo.Name, relPath, err)
+			}
+			l.ETag = etag
+			next[relPath] = l
+		case remoteChanged:
+			if err := s.download(ctx, client, localDir, repo.RemoteDir, relPath, r.MTime); err != nil {
+				s.logger.Warn("syncer", "[%s] failed to download %s: %v", repo.Name, relPath, err)
+				next[relPath] = p
+				continue
+			}
+			report.Downloaded = append(report.Downloaded, relPath)
+			next[relPath] = r
+		case known && !onRemote:
+			// Known locally, gone from the remote, and unchanged locally
+			// since the last sync: the file was deleted on another
+			// device, so mirror the deletion here.
+			if err := os.Remove(filepath.Join(localDir, relPath)); err != nil && !os.IsNotExist(err) {
+				s.logger.Warn("syncer", "[%s] failed to delete local %s: %v", repo.Name, relPath, err)
+				next[relPath] = p
+				continue
+			}
+			report.Deleted = append(report.Deleted, relPath)
+		default:
+			next[relPath] = fileState{ETag: p.ETag, MTime: l.MTime, Size: l.Size, RemoteID: p.RemoteID}
+		}
+	}
+
+	// Files present remotely but not locally: download, unless we know
+	// we deleted them locally (then delete remotely instead).
+	for relPath, r := range remote {
+		if _, onLocal := local[relPath]; onLocal {
+			continue
+		}
+		if _, known := saved[relPath]; known {
+			if err := client.Remove(path.Join(repo.RemoteDir, relPath)); err != nil {
+				s.logger.Warn("syncer", "[%s] failed to delete remote %s: %v", repo.Name, relPath, err)
+				continue
+			}
+			report.Deleted = append(report.Deleted, relPath)
+			continue
+		}
+		if err := s.download(ctx, client, localDir, repo.RemoteDir, relPath, r.MTime); err != nil {
+			s.logger.Warn("syncer", "[%s] failed to download %s: %v", repo.Name, relPath, err)
+			continue
+		}
+		report.Downloaded = append(report.Downloaded, relPath)
+		next[relPath] = r
+	}
+
+	if err := s.saveState(repo.Name, next); err != nil {
+		return report, fmt.Errorf("failed to persist sync state: %v", err)
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+func (s *nativeSyncer) remoteState(ctx context.Context, client *gowebdav.Client, remoteDir string) (map[string]fileState, error) {
+	out := map[string]fileState{}
+	var walk func(relDir string) error
+	walk = func(relDir string) error {
+		infos, err := client.ReadDir(path.Join(remoteDir, relDir))
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			relPath := filepath.Join(relDir, info.Name())
+			if info.IsDir() {
+				if err := walk(relPath); err != nil {
+					return err
+				}
+				continue
+			}
+			var etag string
+			if gf, ok := info.(gowebdav.File); ok {
+				etag = gf.ETag()
+			}
+			out[relPath] = fileState{
+				ETag:  etag,
+				MTime: info.ModTime().Unix(),
+				Size:  info.Size(),
+			}
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *nativeSyncer) localState(localDir string, ignorePatterns []string) (map[string]fileState, error) {
+	out := map[string]fileState{}
+	err := filepath.Walk(localDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || shouldIgnore(p, ignorePatterns) {
+			return nil
+		}
+		relPath, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		out[relPath] = fileState{
+			MTime: info.ModTime().Unix(),
+			Size:  info.Size(),
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (s *nativeSyncer) upload(ctx context.Context, client *gowebdav.Client, localDir, remoteDir, relPath string) error {
+	f, err := os.Open(filepath.Join(localDir, relPath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return client.WriteStream(path.Join(remoteDir, relPath), f, 0644)
+}
+
+// statETag fetches the server-assigned etag for a file that was just
+// uploaded, so the next sync pass compares against the real remote state
+// instead of a value we made up ourselves.
+func (s *nativeSyncer) statETag(client *gowebdav.Client, remotePath string) (string, error) {
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return "", err
+	}
+	gf, ok := info.(gowebdav.File)
+	if !ok {
+		return "", fmt.Errorf("webdav response for %s does not expose an etag", remotePath)
+	}
+	return gf.ETag(), nil
+}
+
+// download fetches relPath from the remote and stamps the local file's
+// mtime to match remoteMTime (a fileState.MTime unix timestamp).
+// Otherwise os.Create would leave the local mtime at "now", localState
+// would see it as newer than the state we're about to persist, and the
+// next sync pass would re-upload the file it just downloaded.
+func (s *nativeSyncer) download(ctx context.Context, client *gowebdav.Client, localDir, remoteDir, relPath string, remoteMTime int64) error {
+	reader, err := client.ReadStream(path.Join(remoteDir, relPath))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	dest := filepath.Join(localDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	mtime := time.Unix(remoteMTime, 0)
+	return os.Chtimes(dest, mtime, mtime)
+}
+
+func (s *nativeSyncer) loadState(repoName string) (map[string]fileState, error) {
+	out := map[string]fileState{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName(repoName))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var fs fileState
+			if err := json.Unmarshal(v, &fs); err != nil {
+				return err
+			}
+			out[string(k)] = fs
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (s *nativeSyncer) saveState(repoName string, state map[string]fileState) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		name := bucketName(repoName)
+		if tx.Bucket(name) != nil {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		b, err := tx.CreateBucket(name)
+		if err != nil {
+			return err
+		}
+		for relPath, fs := range state {
+			data, err := json.Marshal(fs)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(relPath), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// conflictFileName returns the name a locally-conflicting file is renamed
+// to, file.conflict-<host>-<ts>.ext, mirroring the desktop client's
+// convention. The caller does the rename.
+func conflictFileName(relPath string) string {
+	host, _ := os.Hostname()
+	ts := time.Now().Format("2006-01-02-150405")
+	ext := filepath.Ext(relPath)
+	base := strings.TrimSuffix(relPath, ext)
+	return fmt.Sprintf("%s.conflict-%s-%s%s", base, host, ts, ext)
+}